@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// cancelReadTimeout bounds the backend read handleCancelAsync does to find
+// out what the hardware actually settled on, since the cancelled write may
+// have already reached it.
+const cancelReadTimeout = 2 * time.Second
+
+// asyncOp tracks one in-flight ISwitchV3 async state/value change for a
+// single switch id. Only one op can be in flight per id at a time; starting
+// a new one cancels whatever was previously running.
+type asyncOp struct {
+	cancel   context.CancelFunc
+	done     chan struct{}
+	closeOne sync.Once
+
+	targetState bool
+	targetValue float64
+	isValueOp   bool
+
+	prevState bool
+	prevValue float64
+}
+
+func (op *asyncOp) complete() {
+	op.closeOne.Do(func() { close(op.done) })
+}
+
+// opTable holds the in-flight async operations, keyed by switch id. It has
+// its own mutex, deliberately separate from driver.mu, so that starting or
+// cancelling an op never requires holding the driver's big lock across
+// hardware I/O.
+type opTable struct {
+	mu  sync.Mutex
+	ops map[int]*asyncOp
+}
+
+var asyncOps = &opTable{ops: make(map[int]*asyncOp)}
+
+// start cancels any previous op for id and registers a new one.
+func (t *opTable) start(id int, op *asyncOp) {
+	t.mu.Lock()
+	if prev, ok := t.ops[id]; ok {
+		prev.cancel()
+		prev.complete()
+	}
+	t.ops[id] = op
+	t.mu.Unlock()
+}
+
+func (t *opTable) get(id int) (*asyncOp, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	op, ok := t.ops[id]
+	return op, ok
+}
+
+// runAsyncStateChange drives a WriteState call in the background and marks
+// the op complete (successful or not) when it returns.
+func runAsyncStateChange(ctx context.Context, id int, op *asyncOp) {
+	defer op.complete()
+
+	err := driver.backend.WriteState(ctx, id, op.targetState)
+	select {
+	case <-ctx.Done():
+		return
+	default:
+	}
+	if err != nil {
+		log.Printf("async setswitch %d failed: %v", id, err)
+		return
+	}
+
+	driver.mu.Lock()
+	driver.switches[id].State = op.targetState
+	if op.targetState {
+		driver.switches[id].Value = driver.switches[id].MaxValue
+	} else {
+		driver.switches[id].Value = driver.switches[id].MinValue
+	}
+	driver.mu.Unlock()
+
+	persistState(driver)
+	events.Publish(Event{Type: "state", ID: id, State: op.targetState})
+}
+
+func runAsyncValueChange(ctx context.Context, id int, op *asyncOp) {
+	defer op.complete()
+
+	err := driver.backend.WriteValue(ctx, id, op.targetValue)
+	select {
+	case <-ctx.Done():
+		return
+	default:
+	}
+	if err != nil {
+		log.Printf("async setswitchvalue %d failed: %v", id, err)
+		return
+	}
+
+	driver.mu.Lock()
+	driver.switches[id].Value = op.targetValue
+	driver.switches[id].State = op.targetValue > 0
+	driver.mu.Unlock()
+
+	persistState(driver)
+	events.Publish(Event{Type: "value", ID: id, Value: op.targetValue, State: op.targetValue > 0})
+}
+
+func handleSetAsync(w http.ResponseWriter, r *http.Request) {
+	clientTxnID := getClientTransactionID(r)
+
+	if err := r.ParseForm(); err != nil {
+		sendResponse(w, clientTxnID, nil, err)
+		return
+	}
+
+	idStr := r.FormValue("Id")
+	id, err := validateSwitchID(idStr)
+	if err != nil {
+		sendResponse(w, clientTxnID, nil, err)
+		return
+	}
+
+	stateStr := r.FormValue("State")
+	state, err := strconv.ParseBool(stateStr)
+	if err != nil {
+		sendResponse(w, clientTxnID, nil, fmt.Errorf("invalid State parameter"))
+		return
+	}
+
+	driver.mu.RLock()
+	canWrite := driver.switches[id].CanWrite
+	canAsync := driver.switches[id].CanAsync
+	prevState := driver.switches[id].State
+	prevValue := driver.switches[id].Value
+	driver.mu.RUnlock()
+	if !canWrite {
+		sendResponse(w, clientTxnID, nil, fmt.Errorf("switch is read-only"))
+		return
+	}
+	if !canAsync {
+		sendResponse(w, clientTxnID, nil, fmt.Errorf("switch does not support async operations"))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	op := &asyncOp{
+		cancel:      cancel,
+		done:        make(chan struct{}),
+		targetState: state,
+		prevState:   prevState,
+		prevValue:   prevValue,
+	}
+	asyncOps.start(id, op)
+	go runAsyncStateChange(ctx, id, op)
+
+	sendResponse(w, clientTxnID, nil, nil)
+}
+
+func handleSetAsyncValue(w http.ResponseWriter, r *http.Request) {
+	clientTxnID := getClientTransactionID(r)
+
+	if err := r.ParseForm(); err != nil {
+		sendResponse(w, clientTxnID, nil, err)
+		return
+	}
+
+	idStr := r.FormValue("Id")
+	id, err := validateSwitchID(idStr)
+	if err != nil {
+		sendResponse(w, clientTxnID, nil, err)
+		return
+	}
+
+	valueStr := r.FormValue("Value")
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		sendResponse(w, clientTxnID, nil, fmt.Errorf("invalid Value parameter"))
+		return
+	}
+
+	driver.mu.RLock()
+	canWrite := driver.switches[id].CanWrite
+	canAsync := driver.switches[id].CanAsync
+	minValue := driver.switches[id].MinValue
+	maxValue := driver.switches[id].MaxValue
+	prevState := driver.switches[id].State
+	prevValue := driver.switches[id].Value
+	driver.mu.RUnlock()
+	if !canWrite {
+		sendResponse(w, clientTxnID, nil, fmt.Errorf("switch is read-only"))
+		return
+	}
+	if !canAsync {
+		sendResponse(w, clientTxnID, nil, fmt.Errorf("switch does not support async operations"))
+		return
+	}
+	if value < minValue || value > maxValue {
+		sendResponse(w, clientTxnID, nil, fmt.Errorf("value out of range"))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	op := &asyncOp{
+		cancel:      cancel,
+		done:        make(chan struct{}),
+		targetValue: value,
+		isValueOp:   true,
+		prevState:   prevState,
+		prevValue:   prevValue,
+	}
+	asyncOps.start(id, op)
+	go runAsyncValueChange(ctx, id, op)
+
+	sendResponse(w, clientTxnID, nil, nil)
+}
+
+func handleStateChangeComplete(w http.ResponseWriter, r *http.Request) {
+	clientTxnID := getClientTransactionID(r)
+	idStr := r.URL.Query().Get("Id")
+	id, err := validateSwitchID(idStr)
+	if err != nil {
+		sendResponse(w, clientTxnID, nil, err)
+		return
+	}
+
+	op, ok := asyncOps.get(id)
+	if !ok {
+		// No async op was ever started for this id: nothing to wait on.
+		sendResponse(w, clientTxnID, true, nil)
+		return
+	}
+
+	complete := false
+	select {
+	case <-op.done:
+		complete = true
+	default:
+	}
+
+	sendResponse(w, clientTxnID, complete, nil)
+}
+
+func handleCancelAsync(w http.ResponseWriter, r *http.Request) {
+	clientTxnID := getClientTransactionID(r)
+
+	if err := r.ParseForm(); err != nil {
+		sendResponse(w, clientTxnID, nil, err)
+		return
+	}
+
+	idStr := r.FormValue("Id")
+	id, err := validateSwitchID(idStr)
+	if err != nil {
+		sendResponse(w, clientTxnID, nil, err)
+		return
+	}
+
+	op, ok := asyncOps.get(id)
+	if !ok {
+		sendResponse(w, clientTxnID, nil, nil)
+		return
+	}
+
+	op.cancel()
+	op.complete()
+
+	// The in-flight WriteState/WriteValue call may already have reached the
+	// hardware before cancel() had any chance to stop it (backends can't all
+	// abort a write mid-flight, see Backend), so don't assume the cache's
+	// pre-op values still match reality: read the backend back instead of
+	// blindly restoring op.prevState/op.prevValue. Fall back to those only
+	// if the read itself fails.
+	readCtx, readCancel := context.WithTimeout(context.Background(), cancelReadTimeout)
+	defer readCancel()
+	state, stateErr := driver.backend.ReadState(readCtx, id)
+	if stateErr != nil {
+		state = op.prevState
+	}
+	value, valueErr := driver.backend.ReadValue(readCtx, id)
+	if valueErr != nil {
+		value = op.prevValue
+	}
+
+	driver.mu.Lock()
+	driver.switches[id].State = state
+	driver.switches[id].Value = value
+	driver.mu.Unlock()
+
+	persistState(driver)
+	events.Publish(Event{Type: "value", ID: id, Value: value, State: state})
+
+	sendResponse(w, clientTxnID, nil, nil)
+}
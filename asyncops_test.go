@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// slowBackend simulates hardware that never answers within a caller's
+// context, so handleCancelAsync's post-cancel read-back is exercised
+// against a backend that would otherwise hang forever.
+type slowBackend struct{}
+
+func (slowBackend) ReadState(ctx context.Context, id int) (bool, error) {
+	<-ctx.Done()
+	return false, ctx.Err()
+}
+
+func (slowBackend) WriteState(ctx context.Context, id int, state bool) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (slowBackend) ReadValue(ctx context.Context, id int) (float64, error) {
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func (slowBackend) WriteValue(ctx context.Context, id int, v float64) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (slowBackend) Capabilities(id int) Capabilities {
+	return Capabilities{CanRead: true, CanWrite: true, CanValue: true}
+}
+
+// TestHandleCancelAsyncHonorsReadTimeout guards against the regression where
+// a backend that couldn't abort its in-flight call quickly (see
+// ModbusBackend.doWithContext) made cancelasync block far longer than
+// cancelReadTimeout instead of falling back to the op's pre-change values.
+func TestHandleCancelAsyncHonorsReadTimeout(t *testing.T) {
+	origBackend := driver.backend
+	defer func() { driver.backend = origBackend }()
+	driver.backend = slowBackend{}
+
+	const id = 0
+	driver.mu.Lock()
+	driver.switches[id].CanWrite = true
+	driver.switches[id].CanAsync = true
+	driver.switches[id].State = false
+	driver.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	op := &asyncOp{cancel: cancel, done: make(chan struct{}), targetState: true}
+	asyncOps.start(id, op)
+	go runAsyncStateChange(ctx, id, op)
+
+	req := httptest.NewRequest(http.MethodPut, "/cancelasync?Id=0", nil)
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	handleCancelAsync(w, req)
+	elapsed := time.Since(start)
+
+	if elapsed > cancelReadTimeout+time.Second {
+		t.Fatalf("expected handleCancelAsync to return within cancelReadTimeout (%v), took %v", cancelReadTimeout, elapsed)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// modbusCallTimeout bounds how long a single Modbus/TCP request/response can
+// take on the wire. It's deliberately much shorter than goburrow/modbus's
+// 10s default: Close() on a handler takes the same internal lock a
+// blocked Send() is holding, so a stuck call only actually releases the
+// connection once its own read deadline fires, and we want that bounded by
+// something closer to our own ctx timeouts than to 10s.
+const modbusCallTimeout = 3 * time.Second
+
+// Capabilities describes what a backend supports for a given switch channel.
+type Capabilities struct {
+	CanRead  bool
+	CanWrite bool
+	CanValue bool
+}
+
+// Backend abstracts the actual hardware (or simulated hardware) behind a
+// switch channel. Handlers talk to the driver's switches array for cached
+// state/metadata, but all reads and writes of live state/value are routed
+// through the configured Backend. Every method takes a context so a caller
+// driving an ISwitchV3 async operation can ask a backend to give up early;
+// implementations whose underlying I/O can't actually be interrupted
+// mid-flight (e.g. a Modbus PDU already on the wire) should still honor ctx
+// before starting work, and callers must not assume cancellation rolled
+// back anything that had already reached the hardware.
+type Backend interface {
+	// ReadState returns the live on/off state of switch id.
+	ReadState(ctx context.Context, id int) (bool, error)
+	// WriteState sets the on/off state of switch id.
+	WriteState(ctx context.Context, id int, state bool) error
+	// ReadValue returns the live analog value of switch id.
+	ReadValue(ctx context.Context, id int) (float64, error)
+	// WriteValue sets the analog value of switch id.
+	WriteValue(ctx context.Context, id int, v float64) error
+	// Capabilities reports what id supports.
+	Capabilities(id int) Capabilities
+}
+
+// MemoryBackend is the original in-memory behavior: state/value just live on
+// the SwitchDevice struct and every operation always succeeds. It's the
+// default backend and is also what every other backend falls back to for
+// channels it has no mapping for.
+type MemoryBackend struct {
+	driver *SwitchDriver
+}
+
+func NewMemoryBackend(driver *SwitchDriver) *MemoryBackend {
+	return &MemoryBackend{driver: driver}
+}
+
+func (b *MemoryBackend) ReadState(ctx context.Context, id int) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	b.driver.mu.RLock()
+	defer b.driver.mu.RUnlock()
+	return b.driver.switches[id].State, nil
+}
+
+func (b *MemoryBackend) WriteState(ctx context.Context, id int, state bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.driver.mu.Lock()
+	defer b.driver.mu.Unlock()
+	b.driver.switches[id].State = state
+	return nil
+}
+
+func (b *MemoryBackend) ReadValue(ctx context.Context, id int) (float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	b.driver.mu.RLock()
+	defer b.driver.mu.RUnlock()
+	return b.driver.switches[id].Value, nil
+}
+
+func (b *MemoryBackend) WriteValue(ctx context.Context, id int, v float64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.driver.mu.Lock()
+	defer b.driver.mu.Unlock()
+	b.driver.switches[id].Value = v
+	return nil
+}
+
+func (b *MemoryBackend) Capabilities(id int) Capabilities {
+	return Capabilities{CanRead: true, CanWrite: true, CanValue: true}
+}
+
+// ModbusMapping describes where switch id lives on the Modbus/TCP device:
+// a coil for its on/off state and a holding register for its analog value.
+type ModbusMapping struct {
+	Coil            uint16
+	HoldingRegister uint16
+	HasValue        bool
+}
+
+// ModbusBackend drives real hardware over Modbus/TCP. Each switch channel is
+// mapped to a coil (state) and, optionally, a holding register (value).
+// Channels without a mapping entry fall back to in-memory behavior so the
+// driver still reports something sane for unmapped switches.
+type ModbusBackend struct {
+	addr string
+
+	mu        sync.Mutex
+	client    modbus.Client
+	handler   *modbus.TCPClientHandler
+	connected bool
+
+	mappings map[int]ModbusMapping
+	fallback *MemoryBackend
+}
+
+func NewModbusBackend(addr string, mappings map[int]ModbusMapping, fallback *MemoryBackend) (*ModbusBackend, error) {
+	b := &ModbusBackend{
+		addr:     addr,
+		mappings: mappings,
+		fallback: fallback,
+	}
+	if err := b.dial(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// dial connects (or reconnects) the backend's Modbus/TCP handler. Callers
+// must hold b.mu.
+func (b *ModbusBackend) dial() error {
+	handler := modbus.NewTCPClientHandler(b.addr)
+	handler.Timeout = modbusCallTimeout
+	if err := handler.Connect(); err != nil {
+		return fmt.Errorf("connecting to modbus device %s: %w", b.addr, err)
+	}
+	b.handler = handler
+	b.client = modbus.NewClient(handler)
+	b.connected = true
+	return nil
+}
+
+func (b *ModbusBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.connected = false
+	return b.handler.Close()
+}
+
+// doWithContext runs fn, a blocking Modbus/TCP call, against the backend's
+// current client and returns its result. If the connection was left closed
+// by a previous cancellation, it redials first so one cancelled caller
+// doesn't wedge every switch mapped to this backend. goburrow/modbus has no
+// native cancellation, and its handler.Close() takes the same internal lock
+// a blocked Send() is holding, so it won't actually return until that call's
+// own handler.Timeout fires (see modbusCallTimeout) — it is not "immediate"
+// cancellation. So when ctx is done first, doWithContext does not wait for
+// Close(): it marks the backend disconnected (so the next call redials onto
+// a fresh connection right away) and closes the stale handler in the
+// background, without holding b.mu, so one cancelled caller never blocks
+// other switch IDs on this backend behind the defunct connection's lock.
+func (b *ModbusBackend) doWithContext(ctx context.Context, fn func(modbus.Client) error) error {
+	b.mu.Lock()
+	if !b.connected {
+		if err := b.dial(); err != nil {
+			b.mu.Unlock()
+			return fmt.Errorf("reconnecting to modbus device: %w", err)
+		}
+	}
+	client, handler := b.client, b.handler
+	b.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() { done <- fn(client) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		b.mu.Lock()
+		if b.handler == handler {
+			b.connected = false
+		}
+		b.mu.Unlock()
+		go handler.Close()
+		return ctx.Err()
+	}
+}
+
+func (b *ModbusBackend) ReadState(ctx context.Context, id int) (bool, error) {
+	m, ok := b.mappings[id]
+	if !ok {
+		return b.fallback.ReadState(ctx, id)
+	}
+	var state bool
+	err := b.doWithContext(ctx, func(client modbus.Client) error {
+		results, err := client.ReadCoils(m.Coil, 1)
+		if err != nil {
+			return fmt.Errorf("reading coil %d: %w", m.Coil, err)
+		}
+		state = results[0]&0x01 != 0
+		return nil
+	})
+	return state, err
+}
+
+func (b *ModbusBackend) WriteState(ctx context.Context, id int, state bool) error {
+	m, ok := b.mappings[id]
+	if !ok {
+		return b.fallback.WriteState(ctx, id, state)
+	}
+	value := uint16(0x0000)
+	if state {
+		value = 0xFF00
+	}
+	return b.doWithContext(ctx, func(client modbus.Client) error {
+		if _, err := client.WriteSingleCoil(m.Coil, value); err != nil {
+			return fmt.Errorf("writing coil %d: %w", m.Coil, err)
+		}
+		return nil
+	})
+}
+
+func (b *ModbusBackend) ReadValue(ctx context.Context, id int) (float64, error) {
+	m, ok := b.mappings[id]
+	if !ok || !m.HasValue {
+		return b.fallback.ReadValue(ctx, id)
+	}
+	var value float64
+	err := b.doWithContext(ctx, func(client modbus.Client) error {
+		results, err := client.ReadHoldingRegisters(m.HoldingRegister, 1)
+		if err != nil {
+			return fmt.Errorf("reading holding register %d: %w", m.HoldingRegister, err)
+		}
+		value = float64(uint16(results[0])<<8 | uint16(results[1]))
+		return nil
+	})
+	return value, err
+}
+
+func (b *ModbusBackend) WriteValue(ctx context.Context, id int, v float64) error {
+	m, ok := b.mappings[id]
+	if !ok || !m.HasValue {
+		return b.fallback.WriteValue(ctx, id, v)
+	}
+	return b.doWithContext(ctx, func(client modbus.Client) error {
+		if _, err := client.WriteSingleRegister(m.HoldingRegister, uint16(v)); err != nil {
+			return fmt.Errorf("writing holding register %d: %w", m.HoldingRegister, err)
+		}
+		return nil
+	})
+}
+
+func (b *ModbusBackend) Capabilities(id int) Capabilities {
+	m, ok := b.mappings[id]
+	if !ok {
+		return b.fallback.Capabilities(id)
+	}
+	return Capabilities{CanRead: true, CanWrite: true, CanValue: m.HasValue}
+}
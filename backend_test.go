@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeModbusServer is a minimal Modbus/TCP server for exercising
+// ModbusBackend's reconnect-on-next-use behavior. Its first connection
+// reads a request and then goes silent, simulating a device that drops a
+// reply mid-flight; every connection after that answers ReadCoils requests
+// with the configured state.
+type fakeModbusServer struct {
+	ln    net.Listener
+	state bool
+	first bool
+}
+
+func startFakeModbusServer(t *testing.T, state bool) *fakeModbusServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeModbusServer{ln: ln, state: state, first: true}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			silent := s.first
+			s.first = false
+			go s.handle(conn, silent)
+		}
+	}()
+	return s
+}
+
+func (s *fakeModbusServer) handle(conn net.Conn, silent bool) {
+	defer conn.Close()
+
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	length := binary.BigEndian.Uint16(header[4:6])
+	rest := make([]byte, int(length)-1)
+	if _, err := io.ReadFull(conn, rest); err != nil {
+		return
+	}
+	if silent {
+		// Hold the connection open without responding, like a device whose
+		// reply never makes it back, until the client gives up and closes it.
+		io.Copy(io.Discard, conn)
+		return
+	}
+
+	funcCode := rest[0]
+	var respData []byte
+	switch funcCode {
+	case 1: // Read Coils
+		b := byte(0)
+		if s.state {
+			b = 1
+		}
+		respData = []byte{1, b}
+	case 5: // Write Single Coil: echo the request back
+		respData = rest[1:]
+	}
+
+	resp := make([]byte, 8+len(respData))
+	copy(resp[0:2], header[0:2]) // transaction id
+	copy(resp[2:4], header[2:4]) // protocol id
+	binary.BigEndian.PutUint16(resp[4:6], uint16(2+len(respData)))
+	resp[6] = header[6] // unit id
+	resp[7] = funcCode
+	copy(resp[8:], respData)
+	conn.Write(resp)
+}
+
+func TestModbusBackendRedialsAfterCancelledCall(t *testing.T) {
+	srv := startFakeModbusServer(t, true)
+	defer srv.ln.Close()
+
+	fallback := NewMemoryBackend(&SwitchDriver{})
+	mappings := map[int]ModbusMapping{0: {Coil: 0}}
+	b, err := NewModbusBackend(srv.ln.Addr().String(), mappings, fallback)
+	if err != nil {
+		t.Fatalf("NewModbusBackend: %v", err)
+	}
+	defer b.Close()
+
+	cancelCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := b.ReadState(cancelCtx, 0); err != cancelCtx.Err() {
+		t.Fatalf("expected the call against the silent connection to return ctx.Err(), got %v", err)
+	}
+
+	state, err := b.ReadState(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("ReadState after the cancelled call should redial and succeed, got %v", err)
+	}
+	if !state {
+		t.Fatalf("expected state true from the fake server, got %v", state)
+	}
+}
+
+func TestModbusBackendCancelledCallDoesNotBlockOtherSwitches(t *testing.T) {
+	srv := startFakeModbusServer(t, true)
+	defer srv.ln.Close()
+
+	fallback := NewMemoryBackend(&SwitchDriver{})
+	mappings := map[int]ModbusMapping{0: {Coil: 0}, 1: {Coil: 1}}
+	b, err := NewModbusBackend(srv.ln.Addr().String(), mappings, fallback)
+	if err != nil {
+		t.Fatalf("NewModbusBackend: %v", err)
+	}
+	defer b.Close()
+
+	cancelCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := b.ReadState(cancelCtx, 0); err != cancelCtx.Err() {
+		t.Fatalf("expected the call against the silent connection to return ctx.Err(), got %v", err)
+	}
+
+	// A call for an unrelated switch id must not wait behind the stuck
+	// connection's own handler.Timeout (modbusCallTimeout) while it closes
+	// in the background.
+	start := time.Now()
+	if _, err := b.ReadState(context.Background(), 1); err != nil {
+		t.Fatalf("ReadState for a different switch id after the cancelled call should redial and succeed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the next call to proceed without waiting on the stuck connection's close, took %v", elapsed)
+	}
+}
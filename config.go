@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// SwitchConfig describes the startup metadata and hardware mapping for a
+// single switch channel.
+type SwitchConfig struct {
+	Name           string  `json:"name"`
+	Description    string  `json:"description"`
+	MinValue       float64 `json:"minValue"`
+	MaxValue       float64 `json:"maxValue"`
+	CanWrite       bool    `json:"canWrite"`
+	CanAsync       bool    `json:"canAsync"`
+	ModbusCoil     *uint16 `json:"modbusCoil,omitempty"`
+	ModbusRegister *uint16 `json:"modbusRegister,omitempty"`
+}
+
+// Config is the on-disk driver configuration, loaded once at startup.
+type Config struct {
+	Backend    string         `json:"backend"` // "memory" or "modbus"
+	ModbusAddr string         `json:"modbusAddr,omitempty"`
+	Switches   []SwitchConfig `json:"switches"`
+}
+
+// DefaultConfig reproduces the hard-coded switches the driver used before
+// config files existed (with CanAsync now true, where those had it false),
+// so a missing --config still boots cleanly.
+func DefaultConfig() Config {
+	cfg := Config{Backend: "memory"}
+	for i := 0; i < MaxSwitch; i++ {
+		cfg.Switches = append(cfg.Switches, SwitchConfig{
+			Name:        fmt.Sprintf("Switch %d", i),
+			Description: fmt.Sprintf("Switch device number %d", i),
+			MinValue:    0.0,
+			MaxValue:    1.0,
+			CanWrite:    true,
+			CanAsync:    true,
+		})
+	}
+	return cfg
+}
+
+// LoadConfig reads and validates a driver config file.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading config %s: %w", path, err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	if len(cfg.Switches) == 0 {
+		return Config{}, fmt.Errorf("config must define at least one switch")
+	}
+	if len(cfg.Switches) > MaxSwitch {
+		return Config{}, fmt.Errorf("config defines %d switches, max is %d", len(cfg.Switches), MaxSwitch)
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = "memory"
+	}
+	return cfg, nil
+}
+
+// modbusMappings extracts the per-switch ModbusMapping table from a Config.
+func modbusMappings(cfg Config) map[int]ModbusMapping {
+	mappings := make(map[int]ModbusMapping)
+	for i, sw := range cfg.Switches {
+		if sw.ModbusCoil == nil {
+			continue
+		}
+		m := ModbusMapping{Coil: *sw.ModbusCoil}
+		if sw.ModbusRegister != nil {
+			m.HoldingRegister = *sw.ModbusRegister
+			m.HasValue = true
+		}
+		mappings[i] = m
+	}
+	return mappings
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Event is a single mutation pushed to /events/switch subscribers.
+type Event struct {
+	Type string `json:"type"` // "state", "value", or "name"
+	ID   int    `json:"id"`
+	// State and Value are meaningful at their zero values (off, 0.0), so
+	// they're never omitempty: a switch turning off or a value going to 0
+	// must still serialize the field, not drop it.
+	State bool    `json:"state"`
+	Value float64 `json:"value"`
+	Name  string  `json:"name,omitempty"`
+}
+
+// broadcaster fans a stream of Events out to any number of SSE clients.
+type broadcaster struct {
+	mu      sync.Mutex
+	clients map[chan Event]struct{}
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{clients: make(map[chan Event]struct{})}
+}
+
+func (b *broadcaster) subscribe() chan Event {
+	ch := make(chan Event, 16)
+	b.mu.Lock()
+	b.clients[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *broadcaster) unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	if _, ok := b.clients[ch]; ok {
+		delete(b.clients, ch)
+		close(ch)
+	}
+	b.mu.Unlock()
+}
+
+// Publish fans ev out to every subscriber. A subscriber whose buffer is
+// full is skipped rather than blocking the writer that triggered the event.
+func (b *broadcaster) Publish(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.clients {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+var events = newBroadcaster()
+
+// handleEventsStream upgrades to text/event-stream and pushes a JSON Event
+// every time a handler mutates a switch's state, value, or name.
+func handleEventsStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ch := events.subscribe()
+	defer events.unsubscribe(ch)
+
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
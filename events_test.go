@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestEventMarshalsZeroStateAndValue guards against omitempty dropping a
+// false State or a zero Value: the status page's onmessage handler expects
+// both fields on every "state"/"value" event, and their zero values are
+// ordinary, in-range data (switch off, value at MinValue=0), not absence.
+func TestEventMarshalsZeroStateAndValue(t *testing.T) {
+	ev := Event{Type: "value", ID: 2, State: false, Value: 0}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if _, ok := decoded["state"]; !ok {
+		t.Fatalf("expected \"state\" key to be present even when false, got %s", data)
+	}
+	if _, ok := decoded["value"]; !ok {
+		t.Fatalf("expected \"value\" key to be present even when zero, got %s", data)
+	}
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -52,6 +54,9 @@ type SwitchDriver struct {
 	switches            [MaxSwitch]SwitchDevice
 	connected           bool
 	serverTransactionID uint32
+	backend             Backend
+	store               StateStore
+	txnCounter          *txnCounterStore
 }
 
 var driver *SwitchDriver
@@ -60,23 +65,94 @@ func init() {
 	driver = &SwitchDriver{
 		connected: false,
 	}
+	applyConfig(driver, DefaultConfig())
+	driver.backend = NewMemoryBackend(driver)
+	driver.store = NoopStateStore{}
+}
 
-	// Initialize switches
-	for i := 0; i < MaxSwitch; i++ {
-		driver.switches[i] = SwitchDevice{
-			Name:        fmt.Sprintf("Switch %d", i),
-			Description: fmt.Sprintf("Switch device number %d", i),
+// applyConfig populates driver.switches from cfg. It does not touch the
+// backend, so it's safe to call before the backend has been selected.
+func applyConfig(d *SwitchDriver, cfg Config) {
+	for i, sw := range cfg.Switches {
+		d.switches[i] = SwitchDevice{
+			Name:        sw.Name,
+			Description: sw.Description,
 			State:       false,
 			Value:       0.0,
-			MinValue:    0.0,
-			MaxValue:    1.0,
-			CanWrite:    true,
-			CanAsync:    false,
+			MinValue:    sw.MinValue,
+			MaxValue:    sw.MaxValue,
+			CanWrite:    sw.CanWrite,
+			CanAsync:    sw.CanAsync,
 		}
 	}
 }
 
 func main() {
+	configPath := flag.String("config", "", "path to driver config file (JSON); defaults to the built-in 6-switch memory config")
+	stateSink := flag.String("state-sink", "memory", "where to persist switch state: \"memory\" (no-op) or \"file\"")
+	stateFile := flag.String("state-file", "switch-state.json", "path to the state file when --state-sink=file")
+	stateBackups := flag.Int("state-backups", 3, "number of rotated state-file backups to keep")
+	txnCounterFile := flag.String("txn-counter-file", "transaction-counter.txt", "path used to persist the server transaction ID counter across restarts; empty disables persistence")
+	authUser := flag.String("auth-user", os.Getenv("ALPACA_AUTH_USER"), "HTTP Basic auth username; unset disables auth")
+	authPass := flag.String("auth-pass", os.Getenv("ALPACA_AUTH_PASS"), "HTTP Basic auth password")
+	rateLimit := flag.Float64("rate-limit", 10, "max requests/sec allowed per client IP; <= 0 disables rate limiting")
+	rateBurst := flag.Float64("rate-burst", 20, "token bucket burst size per client IP")
+	flag.Parse()
+
+	AuthConfig.User = *authUser
+	AuthConfig.Pass = *authPass
+	RateLimitConfig.RatePerSec = *rateLimit
+	RateLimitConfig.Burst = *rateBurst
+
+	driver.txnCounter = newTxnCounterStore(*txnCounterFile)
+	driver.serverTransactionID = driver.txnCounter.load()
+
+	cfg := DefaultConfig()
+	if *configPath != "" {
+		loaded, err := LoadConfig(*configPath)
+		if err != nil {
+			log.Fatalf("loading config: %v", err)
+		}
+		cfg = loaded
+	}
+	applyConfig(driver, cfg)
+
+	switch *stateSink {
+	case "memory":
+		driver.store = NoopStateStore{}
+	case "file":
+		driver.store = NewJSONFileStateStore(*stateFile, *stateBackups)
+	default:
+		log.Fatalf("unknown state sink %q", *stateSink)
+	}
+	if snapshot, err := driver.store.Load(); err == nil {
+		// Only carry forward the live State/Value the store remembers; the
+		// rest of each SwitchDevice (Name, Description, Min/MaxValue,
+		// CanWrite, CanAsync) is config-owned, set by applyConfig above.
+		// Overwriting the whole struct from the snapshot would make
+		// re-running with an edited --config silently do nothing for
+		// existing switches until the state file was deleted.
+		driver.mu.Lock()
+		for i := range driver.switches {
+			driver.switches[i].State = snapshot[i].State
+			driver.switches[i].Value = snapshot[i].Value
+		}
+		driver.mu.Unlock()
+	}
+
+	switch cfg.Backend {
+	case "", "memory":
+		driver.backend = NewMemoryBackend(driver)
+	case "modbus":
+		backend, err := NewModbusBackend(cfg.ModbusAddr, modbusMappings(cfg), NewMemoryBackend(driver))
+		if err != nil {
+			log.Fatalf("initializing modbus backend: %v", err)
+		}
+		driver.backend = backend
+	default:
+		log.Fatalf("unknown backend %q", cfg.Backend)
+	}
+
 	// Start UDP discovery service
 	go startDiscoveryService()
 
@@ -104,17 +180,29 @@ func main() {
 	r.HandleFunc("/api/v1/switch/{device_number}/setswitch", handleSetSwitch).Methods("PUT")
 	r.HandleFunc("/api/v1/switch/{device_number}/setswitchname", handleSetSwitchName).Methods("PUT")
 	r.HandleFunc("/api/v1/switch/{device_number}/setswitchvalue", handleSetSwitchValue).Methods("PUT")
+	r.HandleFunc("/api/v1/switch/{device_number}/setasync", handleSetAsync).Methods("PUT")
+	r.HandleFunc("/api/v1/switch/{device_number}/setasyncvalue", handleSetAsyncValue).Methods("PUT")
+	r.HandleFunc("/api/v1/switch/{device_number}/statechangecomplete", handleStateChangeComplete).Methods("GET")
+	r.HandleFunc("/api/v1/switch/{device_number}/cancelasync", handleCancelAsync).Methods("PUT")
 
 	// Management API - basic discovery
 	r.HandleFunc("/management/apiversions", handleAPIVersions).Methods("GET")
 	r.HandleFunc("/management/v1/description", handleManagementDescription).Methods("GET")
 	r.HandleFunc("/management/v1/configureddevices", handleConfiguredDevices).Methods("GET")
 
+	// Live state stream
+	r.HandleFunc("/events/switch", handleEventsStream).Methods("GET")
+
 	// Status page
 	r.HandleFunc("/", handleStatusPage).Methods("GET")
 
-	// Enable CORS for all routes
+	// Enable CORS for all routes, then structured logging, then rate
+	// limiting and auth, outermost-first so the logger sees the final
+	// response including any rejection from the other two.
 	r.Use(corsMiddleware)
+	r.Use(loggingMiddleware)
+	r.Use(rateLimitMiddleware)
+	r.Use(authMiddleware)
 
 	addr := fmt.Sprintf(":%d", APIPort)
 	log.Printf("Starting ASCOM Alpaca Switch Driver")
@@ -225,7 +313,9 @@ func getNextServerTransactionID() uint32 {
 	driver.mu.Lock()
 	defer driver.mu.Unlock()
 	driver.serverTransactionID++
-	return driver.serverTransactionID
+	id := driver.serverTransactionID
+	driver.txnCounter.scheduleSave(id)
+	return id
 }
 
 func sendResponse(w http.ResponseWriter, clientTxnID uint32, value interface{}, err error) {
@@ -302,7 +392,7 @@ func handleDriverVersion(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleInterfaceVersion(w http.ResponseWriter, r *http.Request) {
-	sendResponse(w, getClientTransactionID(r), 2, nil) // ISwitchV2
+	sendResponse(w, getClientTransactionID(r), 3, nil) // ISwitchV3
 }
 
 func handleName(w http.ResponseWriter, r *http.Request) {
@@ -359,9 +449,15 @@ func handleGetSwitch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	driver.mu.RLock()
-	state := driver.switches[id].State
-	driver.mu.RUnlock()
+	state, err := driver.backend.ReadState(r.Context(), id)
+	if err != nil {
+		sendResponse(w, clientTxnID, nil, fmt.Errorf("reading switch state: %w", err))
+		return
+	}
+
+	driver.mu.Lock()
+	driver.switches[id].State = state
+	driver.mu.Unlock()
 
 	sendResponse(w, clientTxnID, state, nil)
 }
@@ -407,9 +503,15 @@ func handleGetSwitchValue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	driver.mu.RLock()
-	value := driver.switches[id].Value
-	driver.mu.RUnlock()
+	value, err := driver.backend.ReadValue(r.Context(), id)
+	if err != nil {
+		sendResponse(w, clientTxnID, nil, fmt.Errorf("reading switch value: %w", err))
+		return
+	}
+
+	driver.mu.Lock()
+	driver.switches[id].Value = value
+	driver.mu.Unlock()
 
 	sendResponse(w, clientTxnID, value, nil)
 }
@@ -468,12 +570,20 @@ func handleSetSwitch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	driver.mu.Lock()
-	if !driver.switches[id].CanWrite {
-		driver.mu.Unlock()
+	driver.mu.RLock()
+	canWrite := driver.switches[id].CanWrite
+	driver.mu.RUnlock()
+	if !canWrite {
 		sendResponse(w, clientTxnID, nil, fmt.Errorf("switch is read-only"))
 		return
 	}
+
+	if err := driver.backend.WriteState(r.Context(), id, state); err != nil {
+		sendResponse(w, clientTxnID, nil, fmt.Errorf("writing switch state: %w", err))
+		return
+	}
+
+	driver.mu.Lock()
 	driver.switches[id].State = state
 	if state {
 		driver.switches[id].Value = driver.switches[id].MaxValue
@@ -482,7 +592,8 @@ func handleSetSwitch(w http.ResponseWriter, r *http.Request) {
 	}
 	driver.mu.Unlock()
 
-	log.Printf("Switch %d set to %v", id, state)
+	persistState(driver)
+	events.Publish(Event{Type: "state", ID: id, State: state})
 	sendResponse(w, clientTxnID, nil, nil)
 }
 
@@ -511,6 +622,8 @@ func handleSetSwitchName(w http.ResponseWriter, r *http.Request) {
 	driver.switches[id].Name = name
 	driver.mu.Unlock()
 
+	persistState(driver)
+	events.Publish(Event{Type: "name", ID: id, Name: name})
 	sendResponse(w, clientTxnID, nil, nil)
 }
 
@@ -536,22 +649,32 @@ func handleSetSwitchValue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	driver.mu.Lock()
-	if !driver.switches[id].CanWrite {
-		driver.mu.Unlock()
+	driver.mu.RLock()
+	canWrite := driver.switches[id].CanWrite
+	minValue := driver.switches[id].MinValue
+	maxValue := driver.switches[id].MaxValue
+	driver.mu.RUnlock()
+	if !canWrite {
 		sendResponse(w, clientTxnID, nil, fmt.Errorf("switch is read-only"))
 		return
 	}
-	if value < driver.switches[id].MinValue || value > driver.switches[id].MaxValue {
-		driver.mu.Unlock()
+	if value < minValue || value > maxValue {
 		sendResponse(w, clientTxnID, nil, fmt.Errorf("value out of range"))
 		return
 	}
+
+	if err := driver.backend.WriteValue(r.Context(), id, value); err != nil {
+		sendResponse(w, clientTxnID, nil, fmt.Errorf("writing switch value: %w", err))
+		return
+	}
+
+	driver.mu.Lock()
 	driver.switches[id].Value = value
 	driver.switches[id].State = value > 0
 	driver.mu.Unlock()
 
-	log.Printf("Switch %d value set to %f", id, value)
+	persistState(driver)
+	events.Publish(Event{Type: "value", ID: id, Value: value, State: value > 0})
 	sendResponse(w, clientTxnID, nil, nil)
 }
 
@@ -692,24 +815,68 @@ func handleStatusPage(w http.ResponseWriter, r *http.Request) {
 		}
 
 		html += fmt.Sprintf(`
-        <div class="switch-card">
-            <div class="switch-header">Switch %d</div>
-            <div class="switch-status %s">%s</div>
-            <div class="property"><span class="label">Name:</span> %s</div>
+        <div class="switch-card" id="switch-card-%d">
+            <div class="switch-header" id="switch-name-%d">%s</div>
+            <div class="switch-status %s" id="switch-status-%d">%s</div>
             <div class="property"><span class="label">Description:</span> %s</div>
-            <div class="property"><span class="label">Value:</span> %.2f</div>
+            <div class="property"><span class="label">Value:</span> <span id="switch-value-%d">%.2f</span></div>
             <div class="property"><span class="label">Range:</span> %.2f - %.2f</div>
             <div class="property"><span class="label">Writable:</span> %v</div>
-        </div>`, i, statusClass, statusText, sw.Name, sw.Description, sw.Value, sw.MinValue, sw.MaxValue, sw.CanWrite)
+        </div>`, i, i, sw.Name, statusClass, i, statusText, sw.Description, i, sw.Value, sw.MinValue, sw.MaxValue, sw.CanWrite)
 	}
 
 	html += `
     </div>
-    
+
     <div class="footer">
-        <p>Page automatically refreshes every 5 seconds</p>
+        <p id="stream-status">Connecting to live update stream&hellip;</p>
         <p>ASCOM Alpaca Device API v1</p>
     </div>
+
+    <script>
+        (function () {
+            var refreshMeta = document.querySelector('meta[http-equiv="refresh"]');
+            var statusLine = document.getElementById('stream-status');
+
+            if (!window.EventSource) {
+                statusLine.textContent = 'Live updates unavailable; falling back to page refresh.';
+                return;
+            }
+
+            var source = new EventSource('/events/switch');
+
+            source.onopen = function () {
+                if (refreshMeta) {
+                    refreshMeta.remove();
+                }
+                statusLine.textContent = 'Live updates connected.';
+            };
+
+            source.onerror = function () {
+                statusLine.textContent = 'Live update stream lost; falling back to page refresh.';
+            };
+
+            source.onmessage = function (e) {
+                var ev = JSON.parse(e.data);
+                var statusEl = document.getElementById('switch-status-' + ev.id);
+                var valueEl = document.getElementById('switch-value-' + ev.id);
+                var nameEl = document.getElementById('switch-name-' + ev.id);
+
+                if (ev.type === 'name' && nameEl) {
+                    nameEl.textContent = ev.name;
+                }
+                if (ev.type === 'state' || ev.type === 'value') {
+                    if (statusEl) {
+                        statusEl.textContent = ev.state ? 'ON' : 'OFF';
+                        statusEl.className = 'switch-status ' + (ev.state ? 'status-on' : 'status-off');
+                    }
+                }
+                if (ev.type === 'value' && valueEl) {
+                    valueEl.textContent = ev.value.toFixed(2);
+                }
+            };
+        })();
+    </script>
 </body>
 </html>`
 
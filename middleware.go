@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthConfig holds the optional HTTP Basic credentials gating every Alpaca
+// request. Leaving User empty disables auth entirely.
+var AuthConfig struct {
+	User string
+	Pass string
+}
+
+// writeAlpacaError writes an Alpaca-shaped error response directly,
+// bypassing the normal handler/sendResponse path, for middleware that
+// rejects a request before it reaches a route handler.
+func writeAlpacaError(w http.ResponseWriter, r *http.Request, status, errNum int, msg string) {
+	response := AlpacaResponse{
+		ClientTransactionID: getClientTransactionID(r),
+		ServerTransactionID: getNextServerTransactionID(),
+		ErrorNumber:         errNum,
+		ErrorMessage:        msg,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// authMiddleware enforces HTTP Basic auth when AuthConfig.User is set.
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if AuthConfig.User == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != AuthConfig.User || pass != AuthConfig.Pass {
+			w.Header().Set("WWW-Authenticate", `Basic realm="ASCOM Alpaca"`)
+			writeAlpacaError(w, r, http.StatusUnauthorized, 0x401, "invalid credentials")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tokenBucket is a minimal per-client token bucket: it refills at
+// RatePerSec tokens/second up to Burst tokens, and Allow reports whether a
+// token was available for the current request.
+type tokenBucket struct {
+	mu         sync.Mutex
+	tokens     float64
+	rate       float64
+	burst      float64
+	lastRefill time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{tokens: burst, rate: rate, burst: burst, lastRefill: time.Now()}
+}
+
+func (b *tokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(b.lastRefill).Seconds()
+	b.lastRefill = now
+	b.tokens += elapsed * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RateLimitConfig tunes the per-IP limiter installed by rateLimitMiddleware.
+// RatePerSec <= 0 disables rate limiting entirely.
+var RateLimitConfig struct {
+	RatePerSec float64
+	Burst      float64
+}
+
+var (
+	rateLimiters   = make(map[string]*tokenBucket)
+	rateLimitersMu sync.Mutex
+)
+
+func rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if RateLimitConfig.RatePerSec <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := remoteIP(r)
+
+		rateLimitersMu.Lock()
+		bucket, ok := rateLimiters[ip]
+		if !ok {
+			bucket = newTokenBucket(RateLimitConfig.RatePerSec, RateLimitConfig.Burst)
+			rateLimiters[ip] = bucket
+		}
+		rateLimitersMu.Unlock()
+
+		if !bucket.Allow() {
+			writeAlpacaError(w, r, http.StatusTooManyRequests, 0x429, "rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// remoteIP extracts the client IP from a request, stripping the port if
+// present.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// responseRecorder captures the status and body a handler writes so
+// loggingMiddleware can report what actually went out without altering it.
+// It skips capturing the body for streaming responses (identified by a
+// text/event-stream Content-Type, e.g. /events/switch): those connections
+// stay open indefinitely, and buffering every push would grow without
+// bound for as long as a client stays subscribed.
+type responseRecorder struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	streaming bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	if strings.HasPrefix(rec.Header().Get("Content-Type"), "text/event-stream") {
+		rec.streaming = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if !rec.streaming {
+		rec.body.Write(b)
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Flush makes responseRecorder satisfy http.Flusher by forwarding to the
+// underlying ResponseWriter, so wrapping a handler in this middleware
+// doesn't silently turn off flushing for a streaming endpoint like
+// /events/switch.
+func (rec *responseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// loggingMiddleware emits one structured JSON log line per request,
+// replacing the ad-hoc log.Printf calls scattered through the handlers.
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		var resp AlpacaResponse
+		json.Unmarshal(rec.body.Bytes(), &resp) // best-effort; non-Alpaca routes won't parse
+
+		entry := map[string]interface{}{
+			"clientId":            r.URL.Query().Get("ClientID"),
+			"clientTransactionId": resp.ClientTransactionID,
+			"serverTransactionId": resp.ServerTransactionID,
+			"method":              r.Method,
+			"path":                r.URL.Path,
+			"remoteIp":            remoteIP(r),
+			"status":              rec.status,
+			"latencyMs":           time.Since(start).Milliseconds(),
+			"errorNumber":         resp.ErrorNumber,
+		}
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		log.Println(string(line))
+	})
+}
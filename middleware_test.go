@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketAllowsBurstThenBlocks(t *testing.T) {
+	b := newTokenBucket(1, 3) // 1 token/sec, burst of 3
+
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatalf("request %d within the initial burst should be allowed", i)
+		}
+	}
+	if b.Allow() {
+		t.Fatalf("request beyond the burst should be denied")
+	}
+}
+
+func TestTokenBucketRefillsOverTime(t *testing.T) {
+	b := newTokenBucket(1, 1) // 1 token/sec, burst of 1
+
+	if !b.Allow() {
+		t.Fatalf("first request should be allowed")
+	}
+	if b.Allow() {
+		t.Fatalf("immediate second request should be denied")
+	}
+
+	// Back-date lastRefill instead of sleeping, so the test doesn't depend
+	// on real wall-clock time to exercise the refill math.
+	b.mu.Lock()
+	b.lastRefill = b.lastRefill.Add(-time.Second)
+	b.mu.Unlock()
+
+	if !b.Allow() {
+		t.Fatalf("request after a full refill interval should be allowed")
+	}
+}
+
+func TestTokenBucketCapsRefillAtBurst(t *testing.T) {
+	b := newTokenBucket(100, 2) // fast refill, small burst
+
+	b.mu.Lock()
+	b.lastRefill = b.lastRefill.Add(-time.Hour)
+	b.mu.Unlock()
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if b.Allow() {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Fatalf("expected the long idle period to cap refill at burst=2, got %d allowed", allowed)
+	}
+}
+
+func TestResponseRecorderSkipsBodyCaptureForEventStream(t *testing.T) {
+	underlying := httptest.NewRecorder()
+	rec := &responseRecorder{ResponseWriter: underlying, status: http.StatusOK}
+
+	rec.Header().Set("Content-Type", "text/event-stream")
+	rec.WriteHeader(http.StatusOK)
+	for i := 0; i < 100; i++ {
+		rec.Write([]byte("data: ping\n\n"))
+	}
+
+	if rec.body.Len() != 0 {
+		t.Fatalf("expected streaming writes to skip body capture, got %d bytes buffered", rec.body.Len())
+	}
+	if underlying.Body.Len() == 0 {
+		t.Fatalf("expected streamed writes to still reach the underlying ResponseWriter")
+	}
+}
+
+func TestResponseRecorderCapturesBodyForNormalResponses(t *testing.T) {
+	underlying := httptest.NewRecorder()
+	rec := &responseRecorder{ResponseWriter: underlying, status: http.StatusOK}
+
+	rec.Header().Set("Content-Type", "application/json")
+	rec.WriteHeader(http.StatusOK)
+	rec.Write([]byte(`{"ok":true}`))
+
+	if rec.body.String() != `{"ok":true}` {
+		t.Fatalf("expected the body to be captured for non-streaming responses, got %q", rec.body.String())
+	}
+}
+
+func TestResponseRecorderFlushPassesThrough(t *testing.T) {
+	underlying := httptest.NewRecorder()
+	rec := &responseRecorder{ResponseWriter: underlying, status: http.StatusOK}
+
+	rec.Flush()
+
+	if !underlying.Flushed {
+		t.Fatalf("expected Flush to be forwarded to the underlying ResponseWriter")
+	}
+}
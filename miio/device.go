@@ -0,0 +1,227 @@
+package miio
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultPort = 54321
+
+// defaultTimeout bounds a single request/response round trip when ctx
+// carries no deadline of its own.
+const defaultTimeout = 3 * time.Second
+
+// Device is a client for a single Xiaomi miIO device, addressed over
+// whichever Transport it's given (LAN UDP, the Xiaomi cloud, or both). It
+// keeps a monotonically increasing request id across calls.
+type Device struct {
+	// Transport carries requests to the device. NewDevice sets this to a
+	// LANTransport; swap it (or wrap it with NewAutoTransport) for cloud
+	// or LAN-with-cloud-fallback delivery.
+	Transport Transport
+	// DeviceID is the device's `did`. LAN dialing fills this in
+	// automatically from the hello handshake; cloud-only devices must set
+	// it explicitly before calling.
+	DeviceID string
+	// Options tunes the retry/backoff behavior of Call. It can be changed
+	// at any time between calls.
+	Options CallOptions
+
+	mu     sync.Mutex
+	nextID int
+}
+
+// NewDevice prepares a Device talking to addr (host or host:port, port
+// defaults to 54321) over LAN, using the device's hex-encoded token. Call
+// Dial before issuing any requests.
+func NewDevice(addr, token string) (*Device, error) {
+	tokenBytes, err := hex.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("decoding token: %w", err)
+	}
+	return &Device{
+		Transport: NewLANTransport(addr, tokenBytes),
+		Options:   DefaultCallOptions(),
+	}, nil
+}
+
+// Dial connects the underlying transport, if it needs an explicit connect
+// step (LANTransport does; CloudTransport doesn't). It also picks up the
+// device ID the transport learns during connect, if any.
+func (d *Device) Dial(ctx context.Context) error {
+	if dl, ok := d.Transport.(dialer); ok {
+		if err := dl.Dial(ctx); err != nil {
+			return err
+		}
+	}
+	if lan, ok := d.Transport.(*LANTransport); ok && d.DeviceID == "" {
+		d.DeviceID = lan.DeviceID()
+	}
+	return nil
+}
+
+// Close releases the underlying transport's resources, if it has any to
+// release.
+func (d *Device) Close() error {
+	if c, ok := d.Transport.(interface{ Close() error }); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// hello sends the 32-byte discovery packet over conn and parses the
+// deviceID and stamp out of the reply.
+func hello(conn interface {
+	SetDeadline(time.Time) error
+	Write([]byte) (int, error)
+	Read([]byte) (int, error)
+}, deadline time.Time) ([]byte, uint32, error) {
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, 0, err
+	}
+	if _, err := conn.Write(helloPacket()); err != nil {
+		return nil, 0, err
+	}
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, 0, err
+	}
+	if n < 16 {
+		return nil, 0, fmt.Errorf("hello response too short (%d bytes)", n)
+	}
+	deviceID := append([]byte(nil), buf[8:12]...)
+	stamp := beUint32(buf[12:16])
+	return deviceID, stamp, nil
+}
+
+func beUint32(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+func putBeUint32(b []byte, v uint32) {
+	b[0] = byte(v >> 24)
+	b[1] = byte(v >> 16)
+	b[2] = byte(v >> 8)
+	b[3] = byte(v)
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// rpcResponse is the envelope every miIO method reply is wrapped in.
+type rpcResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("miio error %d: %s", e.Code, e.Message)
+}
+
+// Call issues a JSON-RPC method call over d.Transport, retrying per
+// d.Options, and, if out is non-nil, unmarshals the response's "result"
+// field into it.
+func (d *Device) Call(ctx context.Context, method string, params interface{}, out interface{}) error {
+	return d.CallWithOptions(ctx, method, params, out, d.Options)
+}
+
+// singleCall makes one request/response attempt over the transport.
+func (d *Device) singleCall(ctx context.Context, method string, params interface{}, out interface{}) error {
+	d.mu.Lock()
+	d.nextID++
+	id := d.nextID
+	d.mu.Unlock()
+
+	command := map[string]interface{}{
+		"id":     id,
+		"method": method,
+		"params": params,
+	}
+	payload, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+
+	decrypted, err := d.Transport.RoundTrip(ctx, d.DeviceID, payload)
+	if err != nil {
+		return err
+	}
+
+	var resp rpcResponse
+	if err := json.Unmarshal(decrypted, &resp); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if out != nil && len(resp.Result) > 0 {
+		if err := json.Unmarshal(resp.Result, out); err != nil {
+			return fmt.Errorf("parsing result: %w", err)
+		}
+	}
+	return nil
+}
+
+// Info calls the standard "miIO.info" method and returns the raw device
+// info document.
+func (d *Device) Info(ctx context.Context) (map[string]interface{}, error) {
+	var info map[string]interface{}
+	if err := d.Call(ctx, "miIO.info", []interface{}{}, &info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// GetProperties issues a legacy "get_prop" call for the given property
+// names and returns their values in the same order.
+func (d *Device) GetProperties(ctx context.Context, names ...string) ([]interface{}, error) {
+	var result []interface{}
+	if err := d.Call(ctx, "get_prop", toParams(names), &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetProperties sets each legacy property via its own "set_<name>" method,
+// since the legacy miIO protocol (unlike MIoT) has no bulk setter. Returns
+// the first error encountered, if any.
+func (d *Device) SetProperties(ctx context.Context, m map[string]interface{}) error {
+	for name, value := range m {
+		if err := d.Call(ctx, "set_"+name, []interface{}{value}, nil); err != nil {
+			return fmt.Errorf("setting %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func toParams(names []string) []interface{} {
+	params := make([]interface{}, len(names))
+	for i, n := range names {
+		params[i] = n
+	}
+	return params
+}
+
+// deadline resolves a context's deadline, falling back to now+fallback when
+// ctx has none.
+func deadline(ctx context.Context, fallback time.Duration) time.Time {
+	if dl, ok := ctx.Deadline(); ok {
+		return dl
+	}
+	return time.Now().Add(fallback)
+}
@@ -0,0 +1,120 @@
+package miio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DiscoveredDevice is one reply to a broadcast hello, before a token is
+// known.
+type DiscoveredDevice struct {
+	Addr     string
+	DeviceID []byte
+	Stamp    uint32
+	// Token is only populated when the device is un-provisioned and its
+	// hello response leaks the token in bytes 16:32; zero otherwise.
+	Token []byte
+	Raw   []byte
+}
+
+// Discover broadcasts a hello packet and collects every reply received
+// within timeout. If iface is non-empty, it also sends a directed broadcast
+// out that interface in addition to the global 255.255.255.255 broadcast,
+// which some networks need to actually deliver it.
+func Discover(ctx context.Context, iface string, timeout time.Duration) ([]DiscoveredDevice, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: 0})
+	if err != nil {
+		return nil, fmt.Errorf("opening discovery socket: %w", err)
+	}
+	defer conn.Close()
+
+	dl := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(dl) {
+		dl = ctxDeadline
+	}
+	if err := conn.SetDeadline(dl); err != nil {
+		return nil, err
+	}
+
+	if err := broadcastHello(conn, net.IPv4bcast); err != nil {
+		return nil, err
+	}
+	if iface != "" {
+		if ip, err := interfaceBroadcast(iface); err == nil {
+			_ = broadcastHello(conn, ip)
+		}
+	}
+
+	var devices []DiscoveredDevice
+	seen := make(map[string]bool)
+	buf := make([]byte, 1024)
+	for {
+		n, remote, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break // deadline reached or socket closed
+		}
+		if n < 16 || seen[remote.String()] {
+			continue
+		}
+		seen[remote.String()] = true
+
+		raw := append([]byte(nil), buf[:n]...)
+		dev := DiscoveredDevice{
+			Addr:     remote.IP.String(),
+			DeviceID: append([]byte(nil), raw[8:12]...),
+			Stamp:    beUint32(raw[12:16]),
+			Raw:      raw,
+		}
+		if n >= 32 && !bytes.Equal(raw[16:32], bytes.Repeat([]byte{0xFF}, 16)) && !isAllZero(raw[16:32]) {
+			dev.Token = append([]byte(nil), raw[16:32]...)
+		}
+		devices = append(devices, dev)
+	}
+	return devices, nil
+}
+
+func broadcastHello(conn *net.UDPConn, ip net.IP) error {
+	_, err := conn.WriteToUDP(helloPacket(), &net.UDPAddr{IP: ip, Port: defaultPort})
+	return err
+}
+
+// interfaceBroadcast computes the IPv4 directed-broadcast address for the
+// named interface's first IPv4 address.
+func interfaceBroadcast(name string) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip4 := ipNet.IP.To4()
+		if ip4 == nil {
+			continue
+		}
+		broadcast := make(net.IP, len(ip4))
+		for i := range ip4 {
+			broadcast[i] = ip4[i] | ^ipNet.Mask[i]
+		}
+		return broadcast, nil
+	}
+	return nil, fmt.Errorf("no IPv4 address on interface %s", name)
+}
+
+func isAllZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
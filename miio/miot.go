@@ -0,0 +1,102 @@
+package miio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// MIoTProperty addresses a single property on a MIoT-spec device: did
+// identifies the device (only required for multi-device gateways; a direct
+// device connection can leave it empty), siid/piid are the service and
+// property instance IDs from the device's MIoT spec.
+type MIoTProperty struct {
+	DID  string `json:"did,omitempty"`
+	SIID int    `json:"siid"`
+	PIID int    `json:"piid"`
+}
+
+// MIoTPropertyValue is a property plus the value to write, used by
+// SetMIoTProperties.
+type MIoTPropertyValue struct {
+	MIoTProperty
+	Value interface{} `json:"value"`
+}
+
+// MIoTPropertyResult is one entry of a get/set_properties response: Code is
+// 0 on success, non-zero on a per-property failure.
+type MIoTPropertyResult struct {
+	MIoTProperty
+	Code  int         `json:"code"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// MIoTPropertyError reports that one or more properties in a batch
+// get/set_properties call failed; Results holds every entry so callers can
+// see which ones succeeded.
+type MIoTPropertyError struct {
+	Results []MIoTPropertyResult
+}
+
+func (e *MIoTPropertyError) Error() string {
+	for _, r := range e.Results {
+		if r.Code != 0 {
+			return fmt.Sprintf("miot property %d.%d failed with code %d", r.SIID, r.PIID, r.Code)
+		}
+	}
+	return "miot property call failed"
+}
+
+func firstFailure(results []MIoTPropertyResult) error {
+	for _, r := range results {
+		if r.Code != 0 {
+			return &MIoTPropertyError{Results: results}
+		}
+	}
+	return nil
+}
+
+// GetMIoTProperties issues a MIoT "get_properties" call for the given
+// properties and returns one result per request, in order.
+func (d *Device) GetMIoTProperties(ctx context.Context, props []MIoTProperty) ([]MIoTPropertyResult, error) {
+	var results []MIoTPropertyResult
+	if err := d.Call(ctx, "get_properties", props, &results); err != nil {
+		return nil, err
+	}
+	return results, firstFailure(results)
+}
+
+// SetMIoTProperties issues a MIoT "set_properties" call, writing each
+// property to its paired value.
+func (d *Device) SetMIoTProperties(ctx context.Context, props []MIoTPropertyValue) ([]MIoTPropertyResult, error) {
+	var results []MIoTPropertyResult
+	if err := d.Call(ctx, "set_properties", props, &results); err != nil {
+		return nil, err
+	}
+	return results, firstFailure(results)
+}
+
+// MIoTActionResult is the response to a MIoT "action" call.
+type MIoTActionResult struct {
+	Code int               `json:"code"`
+	Out  []json.RawMessage `json:"out,omitempty"`
+}
+
+// MIoTAction invokes a MIoT action (aiid) on service siid of device did,
+// passing in as the action's input arguments.
+func (d *Device) MIoTAction(ctx context.Context, did string, siid, aiid int, in []interface{}) (MIoTActionResult, error) {
+	params := map[string]interface{}{
+		"did":  did,
+		"siid": siid,
+		"aiid": aiid,
+		"in":   in,
+	}
+	var result MIoTActionResult
+	if err := d.Call(ctx, "action", params, &result); err != nil {
+		return MIoTActionResult{}, err
+	}
+	if result.Code != 0 {
+		return result, fmt.Errorf("miot action %d.%d failed with code %d", siid, aiid, result.Code)
+	}
+	return result, nil
+}
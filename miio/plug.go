@@ -0,0 +1,39 @@
+package miio
+
+import (
+	"context"
+	"fmt"
+)
+
+// SetPower is a thin convenience wrapper over Call("set_power", ...) for
+// the Mi Smart Plug, which was this package's original single purpose. It
+// checks the reply against {"result":["ok"]} rather than treating any
+// response as success, since a silently-ignored command looks identical to
+// one that actually worked.
+func (d *Device) SetPower(ctx context.Context, on bool) error {
+	state := "off"
+	if on {
+		state = "on"
+	}
+	var result []string
+	if err := d.Call(ctx, "set_power", []interface{}{state}, &result); err != nil {
+		return err
+	}
+	if len(result) == 0 || result[0] != "ok" {
+		return fmt.Errorf("set_power: unexpected result %v", result)
+	}
+	return nil
+}
+
+// GetPower reports the plug's live on/off state.
+func (d *Device) GetPower(ctx context.Context) (bool, error) {
+	values, err := d.GetProperties(ctx, "power")
+	if err != nil {
+		return false, err
+	}
+	if len(values) == 0 {
+		return false, nil
+	}
+	state, _ := values[0].(string)
+	return state == "on", nil
+}
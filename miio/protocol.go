@@ -0,0 +1,102 @@
+// Package miio implements the Xiaomi miIO LAN protocol: a 32-byte binary
+// header framing an AES-CBC encrypted JSON-RPC payload, keyed off a
+// per-device token handed out during pairing.
+package miio
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"fmt"
+)
+
+const helloPacketSize = 32
+
+// helloPacket is the well-known 32-byte discovery/handshake request: magic
+// bytes 21 31, length 0x0020, and the rest FF since no deviceID is known
+// yet.
+func helloPacket() []byte {
+	hello := make([]byte, helloPacketSize)
+	hello[0] = 0x21
+	hello[1] = 0x31
+	hello[2] = 0x00
+	hello[3] = 0x20
+	for i := 4; i < helloPacketSize; i++ {
+		hello[i] = 0xFF
+	}
+	return hello
+}
+
+// buildPacket frames an encrypted payload into a miIO protocol packet.
+func buildPacket(token, deviceID, stamp, encryptedData []byte) []byte {
+	pkt := make([]byte, 32+len(encryptedData))
+	pkt[0] = 0x21
+	pkt[1] = 0x31
+	length := uint16(len(pkt))
+	pkt[2] = byte(length >> 8)
+	pkt[3] = byte(length)
+	copy(pkt[8:12], deviceID)
+	copy(pkt[12:16], stamp)
+	copy(pkt[32:], encryptedData)
+
+	// MD5 checksum over header + token + payload
+	checksumInput := make([]byte, 16+len(token)+len(encryptedData))
+	copy(checksumInput[0:16], pkt[0:16])
+	copy(checksumInput[16:], token)
+	copy(checksumInput[16+len(token):], encryptedData)
+	sum := md5.Sum(checksumInput)
+	copy(pkt[16:32], sum[:])
+	return pkt
+}
+
+// encryptPayload encrypts data with AES-CBC using an MD5-derived key and IV.
+func encryptPayload(data, token []byte) ([]byte, error) {
+	key := md5sum(token)
+	iv := md5sum(append(key, token...))
+
+	// PKCS7 padding
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	padded := make([]byte, len(data)+padding)
+	copy(padded, data)
+	for i := len(data); i < len(padded); i++ {
+		padded[i] = byte(padding)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+	return ciphertext, nil
+}
+
+// decryptPayload reverses encryptPayload.
+func decryptPayload(encryptedData, token []byte) ([]byte, error) {
+	key := md5sum(token)
+	iv := md5sum(append(key, token...))
+
+	if len(encryptedData)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted data length is not a multiple of block size")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(encryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, encryptedData)
+
+	// Strip PKCS7 padding
+	if len(plaintext) > 0 {
+		pad := int(plaintext[len(plaintext)-1])
+		if pad > 0 && pad <= aes.BlockSize && pad <= len(plaintext) {
+			plaintext = plaintext[:len(plaintext)-pad]
+		}
+	}
+	return plaintext, nil
+}
+
+func md5sum(data []byte) []byte {
+	s := md5.Sum(data)
+	return s[:]
+}
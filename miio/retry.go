@@ -0,0 +1,97 @@
+package miio
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// stampDriftTolerance is how many seconds a response's echoed stamp can
+// differ from our projection before LANTransport treats the device's clock
+// as having drifted and resyncs.
+const stampDriftTolerance = 5
+
+// CallOptions controls how Call retries a request.
+type CallOptions struct {
+	Retries        int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultCallOptions is used by NewDevice and is generous enough for a
+// flaky Wi-Fi link without making a genuinely offline device hang for too
+// long.
+func DefaultCallOptions() CallOptions {
+	return CallOptions{
+		Retries:        3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+	}
+}
+
+// CallWithOptions is Call with a one-off override of the retry behavior.
+// It retransmits on timeout with exponential backoff and jitter, and, as a
+// last resort, re-dials the transport to recover a fresh connection (for
+// LANTransport: a new deviceID/stamp via re-hello) before giving the call
+// one final try.
+func (d *Device) CallWithOptions(ctx context.Context, method string, params interface{}, out interface{}, opts CallOptions) error {
+	backoff := opts.InitialBackoff
+	if backoff <= 0 {
+		backoff = DefaultCallOptions().InitialBackoff
+	}
+
+	redialed := false
+	var lastErr error
+
+	for attempt := 0; ; attempt++ {
+		err := d.singleCall(ctx, method, params, out)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+
+		if !isTimeout(err) {
+			// A well-formed rpcError or parse failure won't be fixed by
+			// retrying.
+			return lastErr
+		}
+
+		if attempt >= opts.Retries {
+			if !redialed {
+				redialed = true
+				if dialErr := d.Dial(ctx); dialErr == nil {
+					// One final try on the freshly redialed connection, not
+					// a whole new budget of opts.Retries attempts.
+					lastErr = d.singleCall(ctx, method, params, out)
+					if lastErr == nil {
+						return nil
+					}
+				}
+			}
+			return lastErr
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(jitter(backoff)):
+		}
+		backoff *= 2
+		if backoff > opts.MaxBackoff {
+			backoff = opts.MaxBackoff
+		}
+	}
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// jitter returns d plus up to 20% random jitter, to avoid synchronized
+// retransmits if multiple devices are being driven at once.
+func jitter(d time.Duration) time.Duration {
+	return d + time.Duration(rand.Int63n(int64(d)/5+1))
+}
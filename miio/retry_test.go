@@ -0,0 +1,95 @@
+package miio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeTimeoutErr satisfies net.Error so isTimeout/CallWithOptions treat it
+// as retryable, without depending on a real network timeout.
+type fakeTimeoutErr struct{}
+
+func (fakeTimeoutErr) Error() string   { return "fake timeout" }
+func (fakeTimeoutErr) Timeout() bool   { return true }
+func (fakeTimeoutErr) Temporary() bool { return true }
+
+// fakeTransport fails with a timeout failCount times before succeeding, and
+// counts how many times Dial is called so tests can assert on re-dial
+// behavior.
+type fakeTransport struct {
+	calls     int
+	dialCalls int
+	failCount int
+}
+
+func (f *fakeTransport) RoundTrip(ctx context.Context, deviceID string, req []byte) ([]byte, error) {
+	f.calls++
+	if f.calls <= f.failCount {
+		return nil, fakeTimeoutErr{}
+	}
+	return []byte(`{"id":1,"result":["ok"]}`), nil
+}
+
+func (f *fakeTransport) Dial(ctx context.Context) error {
+	f.dialCalls++
+	return nil
+}
+
+func TestIsTimeoutUnwrapsNetError(t *testing.T) {
+	wrapped := fmt.Errorf("calling device: %w", fakeTimeoutErr{})
+	if !isTimeout(wrapped) {
+		t.Fatalf("expected isTimeout to see through a wrapped net.Error")
+	}
+	if isTimeout(errors.New("not a timeout")) {
+		t.Fatalf("expected a plain error not to be treated as a timeout")
+	}
+}
+
+func TestCallWithOptionsRetriesOnTimeoutThenSucceeds(t *testing.T) {
+	transport := &fakeTransport{failCount: 2}
+	d := &Device{Transport: transport}
+
+	opts := CallOptions{Retries: 5, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+	var out []string
+	if err := d.CallWithOptions(context.Background(), "get_prop", []string{"power"}, &out, opts); err != nil {
+		t.Fatalf("expected eventual success, got %v", err)
+	}
+	if transport.calls != transport.failCount+1 {
+		t.Fatalf("expected %d attempts (failures + the succeeding one), got %d", transport.failCount+1, transport.calls)
+	}
+}
+
+func TestCallWithOptionsGivesUpAfterRedialAlsoFails(t *testing.T) {
+	transport := &fakeTransport{failCount: 1000} // never succeeds
+	d := &Device{Transport: transport}
+
+	opts := CallOptions{Retries: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	err := d.CallWithOptions(context.Background(), "get_prop", []string{"power"}, nil, opts)
+	if err == nil {
+		t.Fatalf("expected failure once retries and the one re-dial attempt are both exhausted")
+	}
+	if transport.dialCalls != 1 {
+		t.Fatalf("expected exactly one re-dial attempt, got %d", transport.dialCalls)
+	}
+}
+
+func TestCallWithOptionsDoesNotRetryNonTimeoutErrors(t *testing.T) {
+	transport := &fakeTransport{failCount: 0}
+	d := &Device{Transport: transport}
+
+	// Decoding the transport's ["ok"] result into an int forces a parse
+	// error (not a timeout), which should return immediately without
+	// chewing through the retry budget.
+	opts := CallOptions{Retries: 5, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	var out int
+	err := d.CallWithOptions(context.Background(), "get_prop", []string{"power"}, &out, opts)
+	if err == nil {
+		t.Fatalf("expected a parse error unmarshaling [\"ok\"] into an int")
+	}
+	if transport.calls != 1 {
+		t.Fatalf("expected exactly one attempt for a non-timeout error, got %d", transport.calls)
+	}
+}
@@ -0,0 +1,38 @@
+package miio
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// SpecRegistry maps symbolic property names (e.g. "switch.on") to their
+// siid/piid on a given device model, so callers don't need to hard-code
+// MIoT spec numbers.
+type SpecRegistry map[string]MIoTProperty
+
+// LoadSpecRegistry reads a JSON file shaped like:
+//
+//	{"switch.on": {"siid": 2, "piid": 1}, "switch.temperature": {"siid": 2, "piid": 6}}
+func LoadSpecRegistry(path string) (SpecRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading spec registry %s: %w", path, err)
+	}
+	var registry SpecRegistry
+	if err := json.Unmarshal(data, &registry); err != nil {
+		return nil, fmt.Errorf("parsing spec registry %s: %w", path, err)
+	}
+	return registry, nil
+}
+
+// Resolve looks up name and returns a copy of its MIoTProperty with did
+// filled in.
+func (r SpecRegistry) Resolve(did, name string) (MIoTProperty, error) {
+	prop, ok := r[name]
+	if !ok {
+		return MIoTProperty{}, fmt.Errorf("unknown property %q", name)
+	}
+	prop.DID = did
+	return prop, nil
+}
@@ -0,0 +1,127 @@
+package miio
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Sample is one tick of polled property values, e.g. power/load_power for
+// the Mi Smart Plug.
+type Sample struct {
+	Timestamp time.Time
+	Values    map[string]interface{}
+}
+
+// Subscribe repeatedly polls props via the legacy get_prop every interval
+// and pushes a Sample onto the returned channel until ctx is cancelled, at
+// which point the channel is closed. A failed poll is skipped rather than
+// closing the channel, since a flaky reading is far more common than the
+// device actually going away.
+func (d *Device) Subscribe(ctx context.Context, props []string, interval time.Duration) (<-chan Sample, error) {
+	return d.subscribe(ctx, interval, func(ctx context.Context) (map[string]interface{}, error) {
+		values, err := d.GetProperties(ctx, props...)
+		if err != nil {
+			return nil, err
+		}
+		sample := make(map[string]interface{}, len(props))
+		for i, name := range props {
+			if i < len(values) {
+				sample[name] = values[i]
+			}
+		}
+		return sample, nil
+	})
+}
+
+// SubscribeMIoT is Subscribe for MIoT-spec devices: it polls props, keyed by
+// whatever name the caller wants each one reported under, via get_properties
+// instead of the legacy get_prop.
+func (d *Device) SubscribeMIoT(ctx context.Context, props map[string]MIoTProperty, interval time.Duration) (<-chan Sample, error) {
+	names := make([]string, 0, len(props))
+	specs := make([]MIoTProperty, 0, len(props))
+	for name, p := range props {
+		names = append(names, name)
+		specs = append(specs, p)
+	}
+
+	return d.subscribe(ctx, interval, func(ctx context.Context) (map[string]interface{}, error) {
+		results, err := d.GetMIoTProperties(ctx, specs)
+		if err != nil {
+			return nil, err
+		}
+		sample := make(map[string]interface{}, len(names))
+		for i, name := range names {
+			if i < len(results) {
+				sample[name] = results[i].Value
+			}
+		}
+		return sample, nil
+	})
+}
+
+// subscribe runs the polling loop shared by Subscribe and SubscribeMIoT:
+// call poll every interval, skip a failed poll rather than giving up, and
+// stop (closing the returned channel) when ctx is cancelled.
+func (d *Device) subscribe(ctx context.Context, interval time.Duration, poll func(context.Context) (map[string]interface{}, error)) (<-chan Sample, error) {
+	ch := make(chan Sample)
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				values, err := poll(ctx)
+				if err != nil {
+					continue
+				}
+				sample := Sample{Timestamp: time.Now(), Values: values}
+				select {
+				case ch <- sample:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// CumulativeCounter turns a monotonically increasing device counter (e.g.
+// cumulative energy consumption) into per-interval deltas, correctly
+// handling a single wraparound between reads.
+type CumulativeCounter struct {
+	mu   sync.Mutex
+	last uint32
+	have bool
+}
+
+// Delta returns how much the counter increased since the last call (0 on
+// the first call, since there's nothing to compare against yet).
+func (c *CumulativeCounter) Delta(value uint32) uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.have {
+		c.last = value
+		c.have = true
+		return 0
+	}
+
+	var delta uint32
+	if value >= c.last {
+		delta = value - c.last
+	} else {
+		delta = uint32(math.MaxUint32-c.last) + value + 1
+	}
+	c.last = value
+	return delta
+}
@@ -0,0 +1,32 @@
+package miio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCumulativeCounterFirstCallHasNoDelta(t *testing.T) {
+	var c CumulativeCounter
+	if got := c.Delta(100); got != 0 {
+		t.Fatalf("expected the first call to report 0 delta, got %d", got)
+	}
+}
+
+func TestCumulativeCounterNormalIncrease(t *testing.T) {
+	var c CumulativeCounter
+	c.Delta(100)
+	if got := c.Delta(150); got != 50 {
+		t.Fatalf("expected delta 50, got %d", got)
+	}
+}
+
+func TestCumulativeCounterHandlesWraparound(t *testing.T) {
+	var c CumulativeCounter
+	c.Delta(math.MaxUint32 - 10)
+
+	got := c.Delta(5) // counter wrapped past zero between reads
+	want := uint32(16)
+	if got != want {
+		t.Fatalf("expected wraparound delta %d, got %d", want, got)
+	}
+}
@@ -0,0 +1,192 @@
+package miio
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Transport carries a plaintext JSON-RPC request to a device and returns
+// its plaintext JSON-RPC response, hiding whether the trip went over LAN
+// UDP or the Xiaomi cloud. deviceID is the device's `did`, needed by
+// CloudTransport to address its request; LANTransport ignores it since the
+// deviceID is already baked into the UDP packet framing.
+type Transport interface {
+	RoundTrip(ctx context.Context, deviceID string, req []byte) ([]byte, error)
+}
+
+// dialer is implemented by transports that need an explicit connect step
+// before RoundTrip, currently just LANTransport.
+type dialer interface {
+	Dial(ctx context.Context) error
+}
+
+// LANTransport is the original UDP+AES-CBC+MD5 path: it frames, encrypts,
+// sends, and decrypts over a persistent UDP socket, learning the device's
+// ID and stamp from an initial hello handshake and keeping the stamp in
+// sync afterward.
+type LANTransport struct {
+	addr  string
+	token []byte
+
+	mu            sync.Mutex
+	conn          net.Conn
+	deviceID      []byte
+	stampBase     uint32
+	stampObserved time.Time
+}
+
+func NewLANTransport(addr string, token []byte) *LANTransport {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = fmt.Sprintf("%s:%d", addr, defaultPort)
+	}
+	return &LANTransport{addr: addr, token: token}
+}
+
+// Dial opens the UDP socket and performs the hello handshake.
+func (t *LANTransport) Dial(ctx context.Context) error {
+	conn, err := net.Dial("udp", t.addr)
+	if err != nil {
+		return fmt.Errorf("dialing %s: %w", t.addr, err)
+	}
+	deviceID, stamp, err := hello(conn, deadline(ctx, 5*time.Second))
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("hello handshake: %w", err)
+	}
+
+	t.mu.Lock()
+	oldConn := t.conn
+	t.conn = conn
+	t.deviceID = deviceID
+	t.stampBase = stamp
+	t.stampObserved = time.Now()
+	t.mu.Unlock()
+	if oldConn != nil {
+		oldConn.Close()
+	}
+	return nil
+}
+
+func (t *LANTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+// DeviceID returns the device ID learned from the hello handshake, hex
+// encoded, or "" if Dial hasn't succeeded yet.
+func (t *LANTransport) DeviceID() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.deviceID == nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", t.deviceID)
+}
+
+func (t *LANTransport) currentStamp() uint32 {
+	return t.stampBase + uint32(time.Since(t.stampObserved).Seconds())
+}
+
+// RoundTrip sends req (plaintext JSON) and returns the decrypted plaintext
+// JSON response. If the reply's echoed stamp has drifted from what we
+// expected by more than stampDriftTolerance, it resyncs and retries the
+// request once with the corrected stamp before giving up.
+func (t *LANTransport) RoundTrip(ctx context.Context, _ string, req []byte) ([]byte, error) {
+	resp, drifted, err := t.roundTripOnce(ctx, req)
+	if !drifted {
+		return resp, err
+	}
+	return t.roundTripOnceDiscard(ctx, req)
+}
+
+func (t *LANTransport) roundTripOnceDiscard(ctx context.Context, req []byte) ([]byte, error) {
+	resp, _, err := t.roundTripOnce(ctx, req)
+	return resp, err
+}
+
+func (t *LANTransport) roundTripOnce(ctx context.Context, req []byte) (resp []byte, drifted bool, err error) {
+	t.mu.Lock()
+	conn := t.conn
+	deviceID := t.deviceID
+	token := t.token
+	expectedStamp := t.currentStamp()
+	t.mu.Unlock()
+	if conn == nil {
+		return nil, false, fmt.Errorf("lan transport not dialed")
+	}
+
+	encrypted, err := encryptPayload(req, token)
+	if err != nil {
+		return nil, false, err
+	}
+	stamp := make([]byte, 4)
+	putBeUint32(stamp, expectedStamp)
+	packet := buildPacket(token, deviceID, stamp, encrypted)
+
+	if err := conn.SetDeadline(deadline(ctx, defaultTimeout)); err != nil {
+		return nil, false, err
+	}
+	if _, err := conn.Write(packet); err != nil {
+		return nil, false, fmt.Errorf("writing request: %w", err)
+	}
+
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, false, fmt.Errorf("reading response: %w", err)
+	}
+	if n < 32 {
+		return nil, false, fmt.Errorf("response too short (%d bytes)", n)
+	}
+
+	respStamp := beUint32(buf[12:16])
+	if absDiff(respStamp, expectedStamp) > stampDriftTolerance {
+		t.mu.Lock()
+		t.stampBase = respStamp
+		t.stampObserved = time.Now()
+		t.mu.Unlock()
+		drifted = true
+	}
+
+	decrypted, err := decryptPayload(buf[32:n], token)
+	if err != nil {
+		return nil, drifted, fmt.Errorf("decrypting response: %w", err)
+	}
+	return decrypted, drifted, nil
+}
+
+// autoTransport tries the LAN transport first and falls back to the cloud
+// transport if the LAN attempt times out, e.g. because the device is on an
+// isolated IoT VLAN the caller can't reach directly.
+type autoTransport struct {
+	lan   Transport
+	cloud Transport
+}
+
+// NewAutoTransport returns a Transport that prefers lan and falls back to
+// cloud on a LAN timeout. Either may be nil to disable that path.
+func NewAutoTransport(lan, cloud Transport) Transport {
+	return &autoTransport{lan: lan, cloud: cloud}
+}
+
+func (t *autoTransport) RoundTrip(ctx context.Context, deviceID string, req []byte) ([]byte, error) {
+	if t.lan != nil {
+		resp, err := t.lan.RoundTrip(ctx, deviceID, req)
+		if err == nil || !isTimeout(err) || t.cloud == nil {
+			return resp, err
+		}
+	}
+	if t.cloud == nil {
+		return nil, fmt.Errorf("no transport available")
+	}
+	return t.cloud.RoundTrip(ctx, deviceID, req)
+}
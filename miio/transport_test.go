@@ -0,0 +1,60 @@
+package miio
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// startFakeHelloServer answers every UDP datagram it receives with a fixed
+// 32-byte hello reply, enough for LANTransport.Dial's handshake to succeed.
+func startFakeHelloServer(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() {
+		buf := make([]byte, 1024)
+		resp := make([]byte, 32)
+		putBeUint32(resp[8:12], 0xdeadbeef) // deviceID
+		putBeUint32(resp[12:16], 1)         // stamp
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			_ = n
+			if _, err := conn.WriteToUDP(resp, addr); err != nil {
+				return
+			}
+		}
+	}()
+	return conn
+}
+
+func TestLANTransportDialClosesThePreviousConnection(t *testing.T) {
+	srv := startFakeHelloServer(t)
+	defer srv.Close()
+
+	transport := NewLANTransport(srv.LocalAddr().String(), []byte("0123456789abcdef"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := transport.Dial(ctx); err != nil {
+		t.Fatalf("first Dial: %v", err)
+	}
+	firstConn := transport.conn
+
+	if err := transport.Dial(ctx); err != nil {
+		t.Fatalf("second Dial: %v", err)
+	}
+	if transport.conn == firstConn {
+		t.Fatalf("expected the second Dial to replace conn with a new one")
+	}
+
+	if _, err := firstConn.Write([]byte("x")); err == nil {
+		t.Fatalf("expected the first connection to be closed after redialing, but Write succeeded")
+	}
+}
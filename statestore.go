@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// saveDebounce coalesces rapid mutations (e.g. a slider driving repeated
+// setswitchvalue calls) into a single write to the state store.
+const saveDebounce = 500 * time.Millisecond
+
+// StateStore persists switch metadata and last-known state across restarts.
+type StateStore interface {
+	Load() ([MaxSwitch]SwitchDevice, error)
+	Save(snapshot [MaxSwitch]SwitchDevice) error
+}
+
+// NoopStateStore discards everything; it's selected with --state-sink=memory
+// for setups that don't want state surviving a restart.
+type NoopStateStore struct{}
+
+func (NoopStateStore) Load() ([MaxSwitch]SwitchDevice, error) {
+	return [MaxSwitch]SwitchDevice{}, os.ErrNotExist
+}
+
+func (NoopStateStore) Save([MaxSwitch]SwitchDevice) error {
+	return nil
+}
+
+// JSONFileStateStore persists the snapshot as JSON, writing atomically via a
+// temp file + rename so a crash mid-write can never corrupt the file on
+// disk. Older snapshots are rotated as path.1, path.2, ... up to MaxBackups,
+// similar to lumberjack-style log rotation.
+type JSONFileStateStore struct {
+	Path       string
+	MaxBackups int
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	pending [MaxSwitch]SwitchDevice
+}
+
+func NewJSONFileStateStore(path string, maxBackups int) *JSONFileStateStore {
+	return &JSONFileStateStore{Path: path, MaxBackups: maxBackups}
+}
+
+func (s *JSONFileStateStore) Load() ([MaxSwitch]SwitchDevice, error) {
+	var snapshot [MaxSwitch]SwitchDevice
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return snapshot, err
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("parsing state file %s: %w", s.Path, err)
+	}
+	return snapshot, nil
+}
+
+// Save debounces writes: it stashes snapshot and schedules a flush
+// saveDebounce after the first call in a burst, so a rapid run of calls
+// within that window results in exactly one write of the latest snapshot.
+func (s *JSONFileStateStore) Save(snapshot [MaxSwitch]SwitchDevice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending = snapshot
+	if s.timer != nil {
+		return nil
+	}
+	s.timer = time.AfterFunc(saveDebounce, s.flush)
+	return nil
+}
+
+func (s *JSONFileStateStore) flush() {
+	s.mu.Lock()
+	snapshot := s.pending
+	s.timer = nil
+	s.mu.Unlock()
+
+	if err := s.writeAtomic(snapshot); err != nil {
+		log.Printf("state store: writing %s: %v", s.Path, err)
+	}
+}
+
+func (s *JSONFileStateStore) writeAtomic(snapshot [MaxSwitch]SwitchDevice) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.rotateBackups()
+
+	dir := filepath.Dir(s.Path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.Path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, s.Path)
+}
+
+// rotateBackups shifts path.(n-1) -> path.n ... path -> path.1 before a new
+// write, keeping at most MaxBackups old snapshots.
+func (s *JSONFileStateStore) rotateBackups() {
+	if s.MaxBackups <= 0 {
+		return
+	}
+	if _, err := os.Stat(s.Path); err != nil {
+		return // nothing to rotate yet
+	}
+	oldest := fmt.Sprintf("%s.%d", s.Path, s.MaxBackups)
+	os.Remove(oldest)
+	for n := s.MaxBackups - 1; n >= 1; n-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.Path, n), fmt.Sprintf("%s.%d", s.Path, n+1))
+	}
+	os.Rename(s.Path, s.Path+".1")
+}
+
+// persistState saves a snapshot of the current switches through the
+// driver's configured store. Callers hold no lock going in or out.
+func persistState(d *SwitchDriver) {
+	d.mu.RLock()
+	snapshot := d.switches
+	d.mu.RUnlock()
+
+	if err := d.store.Save(snapshot); err != nil {
+		log.Printf("state store: save failed: %v", err)
+	}
+}
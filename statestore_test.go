@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJSONFileStateStoreWriteAndLoadRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := NewJSONFileStateStore(path, 3)
+
+	var snapshot [MaxSwitch]SwitchDevice
+	snapshot[0] = SwitchDevice{Name: "Pump", State: true, Value: 1}
+
+	if err := store.writeAtomic(snapshot); err != nil {
+		t.Fatalf("writeAtomic: %v", err)
+	}
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if loaded[0].Name != "Pump" || !loaded[0].State || loaded[0].Value != 1 {
+		t.Fatalf("loaded snapshot does not match what was written: %+v", loaded[0])
+	}
+}
+
+func TestJSONFileStateStoreDebouncesRapidSaves(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := NewJSONFileStateStore(path, 0)
+
+	for i := 0; i < 5; i++ {
+		var snapshot [MaxSwitch]SwitchDevice
+		snapshot[0].Value = float64(i)
+		if err := store.Save(snapshot); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		t.Fatalf("expected no write before the debounce window elapses")
+	}
+
+	time.Sleep(saveDebounce + 200*time.Millisecond)
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if loaded[0].Value != 4 {
+		t.Fatalf("expected only the latest snapshot (Value=4) to survive the debounce, got %v", loaded[0].Value)
+	}
+}
+
+func TestJSONFileStateStoreRotatesBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := NewJSONFileStateStore(path, 2)
+
+	for i := 0; i < 3; i++ {
+		var snapshot [MaxSwitch]SwitchDevice
+		snapshot[0].Value = float64(i)
+		if err := store.writeAtomic(snapshot); err != nil {
+			t.Fatalf("writeAtomic %d: %v", i, err)
+		}
+	}
+
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("expected %s.1 backup to exist: %v", path, err)
+	}
+	if _, err := os.Stat(path + ".2"); err != nil {
+		t.Fatalf("expected %s.2 backup to exist: %v", path, err)
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Fatalf("expected rotation to cap at MaxBackups=2, but found a .3 backup")
+	}
+}
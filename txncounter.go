@@ -0,0 +1,86 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// txnCounterStore persists the driver's serverTransactionID so it stays
+// monotonic across restarts, which some Alpaca clients rely on to dedupe
+// responses. Writes are debounced the same way state-file saves are, since
+// getNextServerTransactionID is called on every request.
+type txnCounterStore struct {
+	path string
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	pending uint32
+}
+
+func newTxnCounterStore(path string) *txnCounterStore {
+	return &txnCounterStore{path: path}
+}
+
+// load returns the last persisted counter value, or 0 if none exists yet.
+func (s *txnCounterStore) load() uint32 {
+	if s == nil || s.path == "" {
+		return 0
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return 0
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(v)
+}
+
+func (s *txnCounterStore) scheduleSave(value uint32) {
+	if s == nil || s.path == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending = value
+	if s.timer != nil {
+		return
+	}
+	s.timer = time.AfterFunc(saveDebounce, s.flush)
+}
+
+func (s *txnCounterStore) flush() {
+	s.mu.Lock()
+	value := s.pending
+	s.timer = nil
+	s.mu.Unlock()
+
+	dir := filepath.Dir(s.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		log.Printf("txn counter: %v", err)
+		return
+	}
+	tmpPath := tmp.Name()
+	if _, err := tmp.WriteString(strconv.FormatUint(uint64(value), 10)); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		log.Printf("txn counter: %v", err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		log.Printf("txn counter: %v", err)
+		return
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		log.Printf("txn counter: %v", err)
+	}
+}